@@ -0,0 +1,82 @@
+// Copyright 2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config holds the static configuration for a SIP worker, loaded
+// once at startup from YAML and/or environment variables.
+package config
+
+// Config is the top-level configuration for a SIP worker.
+type Config struct {
+	APIKey    string `yaml:"api_key"`
+	APISecret string `yaml:"api_secret"`
+	WsUrl     string `yaml:"ws_url"`
+
+	SIPPort int `yaml:"sip_port"`
+	RTPPort int `yaml:"rtp_port"`
+
+	Logging LoggingConfig `yaml:"logging"`
+
+	// Checkpoint configures the external store used to persist
+	// in-progress SIP<->room mappings so a crashed worker's calls can be
+	// resumed by another worker. Nil/zero-value disables checkpointing.
+	Checkpoint CheckpointConfig `yaml:"checkpoint"`
+
+	// JetStream configures an optional NATS JetStream control plane for
+	// SIP dispatch and room-move signalling. A zero-value Addresses
+	// disables it; the SIP worker then falls back to direct SDK
+	// callbacks only.
+	JetStream JetStreamConfig `yaml:"jet_stream"`
+}
+
+// JetStreamConfig configures the optional JetStream-backed control plane
+// used to publish/consume call commands and lifecycle events.
+type JetStreamConfig struct {
+	Addresses []string `yaml:"addresses"`
+	// Stream is the JetStream stream name backing the sip.call.*
+	// subjects. Defaults to "sip-calls" if unset.
+	Stream string `yaml:"stream"`
+	// RetentionSeconds bounds how long commands/events are retained.
+	// Defaults to 3600 if unset.
+	RetentionSeconds int `yaml:"retention_seconds"`
+}
+
+type LoggingConfig struct {
+	Level string `yaml:"level"`
+}
+
+// CheckpointConfig selects and configures the backend used by the
+// RoomResumer to persist call checkpoints.
+type CheckpointConfig struct {
+	// Backend is one of "", "redis", "nats". Empty disables checkpointing.
+	Backend string `yaml:"backend"`
+
+	// IntervalSeconds is how often a live call checkpoints its state, in seconds.
+	// Defaults to 5 if unset.
+	IntervalSeconds int `yaml:"interval_seconds"`
+
+	Redis RedisCheckpointConfig `yaml:"redis"`
+	NATS  NATSCheckpointConfig  `yaml:"nats"`
+}
+
+type RedisCheckpointConfig struct {
+	Address  string `yaml:"address"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+type NATSCheckpointConfig struct {
+	Addresses []string `yaml:"addresses"`
+	Bucket    string   `yaml:"bucket"`
+}
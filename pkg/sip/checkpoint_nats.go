@@ -0,0 +1,147 @@
+// Copyright 2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/livekit/sip/pkg/config"
+)
+
+type natsCheckpointStore struct {
+	kv jetstream.KeyValue
+}
+
+func newNATSCheckpointStore(conf config.NATSCheckpointConfig) (CheckpointStore, error) {
+	if len(conf.Addresses) == 0 {
+		return nil, fmt.Errorf("sip: nats checkpoint backend requires at least one address")
+	}
+	bucket := conf.Bucket
+	if bucket == "" {
+		bucket = "sip-checkpoints"
+	}
+
+	nc, err := nats.Connect(conf.Addresses[0], nats.DiscoveredServersHandler(func(*nats.Conn) {}))
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	kv, err := js.KeyValue(ctx, bucket)
+	if errors.Is(err, jetstream.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: bucket})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &natsCheckpointStore{kv: kv}, nil
+}
+
+func (s *natsCheckpointStore) Save(ctx context.Context, cp Checkpoint) error {
+	data, err := marshalCheckpoint(cp)
+	if err != nil {
+		return err
+	}
+	_, err = s.kv.Put(ctx, cp.CallID, data)
+	return err
+}
+
+func (s *natsCheckpointStore) Load(ctx context.Context, callID string) (Checkpoint, error) {
+	entry, err := s.kv.Get(ctx, callID)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	return unmarshalCheckpoint(entry.Value())
+}
+
+// Claim mirrors the Redis store's claimTTL-bounded claim: a claim key
+// holding a stale (older than claimTTL) timestamp is treated the same as
+// no claim at all, so a worker that crashes mid-resume doesn't lock the
+// call away from everyone else forever.
+func (s *natsCheckpointStore) Claim(ctx context.Context, callID string) (bool, error) {
+	claimKey := callID + ".claim"
+	now := time.Now()
+
+	entry, err := s.kv.Get(ctx, claimKey)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		if _, err := s.kv.Create(ctx, claimKey, claimValue(now)); err != nil {
+			if errors.Is(err, jetstream.ErrKeyExists) {
+				// Lost the race with another worker's Create.
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if claimedAt, perr := parseClaimValue(entry.Value()); perr == nil && now.Sub(claimedAt) < claimTTL {
+		// Still held by a live worker.
+		return false, nil
+	}
+
+	// The previous claim is stale; steal it, using the revision we just
+	// read so a concurrent steal by another worker loses the race.
+	if _, err := s.kv.Update(ctx, claimKey, claimValue(now), entry.Revision()); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+func claimValue(t time.Time) []byte {
+	return []byte(strconv.FormatInt(t.Unix(), 10))
+}
+
+func parseClaimValue(data []byte) (time.Time, error) {
+	sec, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// Renew extends a claim this worker already holds by overwriting it with
+// a fresh timestamp; Claim treats any claim younger than claimTTL as
+// still live regardless of how many times it has been renewed.
+func (s *natsCheckpointStore) Renew(ctx context.Context, callID string) error {
+	_, err := s.kv.Put(ctx, callID+".claim", claimValue(time.Now()))
+	return err
+}
+
+func (s *natsCheckpointStore) Release(ctx context.Context, callID string) error {
+	if err := s.kv.Delete(ctx, callID+".claim"); err != nil && !errors.Is(err, jetstream.ErrKeyNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (s *natsCheckpointStore) Delete(ctx context.Context, callID string) error {
+	if err := s.kv.Delete(ctx, callID); err != nil {
+		return err
+	}
+	return s.kv.Delete(ctx, callID+".claim")
+}
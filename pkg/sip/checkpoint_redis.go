@@ -0,0 +1,86 @@
+// Copyright 2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sip
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/livekit/sip/pkg/config"
+)
+
+// claimTTL bounds how long a claim survives without the resuming worker
+// extending it, so a worker that crashes mid-resume doesn't permanently
+// lock the call away from everyone else.
+const claimTTL = 30 * time.Second
+
+const checkpointKeyPrefix = "sip:checkpoint:"
+const claimKeyPrefix = "sip:claim:"
+
+type redisCheckpointStore struct {
+	rdb redis.UniversalClient
+}
+
+func newRedisCheckpointStore(conf config.RedisCheckpointConfig) (CheckpointStore, error) {
+	if conf.Address == "" {
+		return nil, fmt.Errorf("sip: redis checkpoint backend requires an address")
+	}
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     conf.Address,
+		Username: conf.Username,
+		Password: conf.Password,
+		DB:       conf.DB,
+	})
+	return &redisCheckpointStore{rdb: rdb}, nil
+}
+
+func (s *redisCheckpointStore) Save(ctx context.Context, cp Checkpoint) error {
+	data, err := marshalCheckpoint(cp)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, checkpointKeyPrefix+cp.CallID, data, 0).Err()
+}
+
+func (s *redisCheckpointStore) Load(ctx context.Context, callID string) (Checkpoint, error) {
+	data, err := s.rdb.Get(ctx, checkpointKeyPrefix+callID).Bytes()
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	return unmarshalCheckpoint(data)
+}
+
+func (s *redisCheckpointStore) Claim(ctx context.Context, callID string) (bool, error) {
+	ok, err := s.rdb.SetNX(ctx, claimKeyPrefix+callID, time.Now().Unix(), claimTTL).Result()
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+func (s *redisCheckpointStore) Renew(ctx context.Context, callID string) error {
+	return s.rdb.Expire(ctx, claimKeyPrefix+callID, claimTTL).Err()
+}
+
+func (s *redisCheckpointStore) Release(ctx context.Context, callID string) error {
+	return s.rdb.Del(ctx, claimKeyPrefix+callID).Err()
+}
+
+func (s *redisCheckpointStore) Delete(ctx context.Context, callID string) error {
+	return s.rdb.Del(ctx, checkpointKeyPrefix+callID, claimKeyPrefix+callID).Err()
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sip
+
+import "errors"
+
+// ErrRoomResyncing is returned by APIs that need the complete room state
+// (participant enumeration, metadata reads) when called during a
+// FastJoin Room's partial-state window, before the full roster has
+// synced.
+var ErrRoomResyncing = errors.New("sip: room is still resyncing after a fast join")
+
+// resyncDone reports whether the full participant/track roster has
+// synced. It is always true for a Room that wasn't FastJoin-connected.
+func (r *Room) resyncDone() bool {
+	select {
+	case <-r.resyncing.Watch():
+		return true
+	default:
+		return false
+	}
+}
+
+// resyncRoster runs in the background for a FastJoin Room, seeding the
+// roster and metadata from the room already in progress and completing
+// the partial-state window once that initial push has settled.
+// Participants who join afterwards arrive through onParticipantJoined,
+// wired into the SDK's participant-connected callback in Connect, and
+// metadata changes arrive through onMetadataChanged the same way.
+func (r *Room) resyncRoster() {
+	r.mu.Lock()
+	room := r.room
+	roomName := r.p.RoomName
+	r.mu.Unlock()
+	if room == nil {
+		r.resyncing.Break()
+		return
+	}
+
+	for _, rp := range room.GetParticipants() {
+		r.onParticipantJoined(ParticipantInfo{
+			RoomName: roomName,
+			Identity: rp.Identity(),
+			Name:     rp.Name(),
+		})
+	}
+	r.onMetadataChanged(room.Metadata())
+
+	r.resyncing.Break()
+
+	if r.subscribe.Load() {
+		_ = r.doSubscribe()
+	}
+}
+
+// onParticipantJoined lazily materializes a remote participant that
+// arrives while a FastJoin resync is still in progress, deduping by
+// identity so a participant who connects in the window between Connect
+// returning and resyncRoster's initial GetParticipants() pass isn't
+// recorded twice.
+func (r *Room) onParticipantJoined(p ParticipantInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.roster {
+		if existing.Identity == p.Identity {
+			r.roster[i] = p
+			return
+		}
+	}
+	r.roster = append(r.roster, p)
+}
+
+// onMetadataChanged records the room's current metadata, wired into the
+// SDK's OnRoomMetadataChanged callback in Connect and also called once
+// from resyncRoster to seed the initial value.
+func (r *Room) onMetadataChanged(metadata string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata = metadata
+}
+
+// Participants enumerates the full remote participant roster. It returns
+// ErrRoomResyncing if called before a FastJoin resync has completed.
+func (r *Room) Participants() ([]ParticipantInfo, error) {
+	if !r.resyncDone() {
+		return nil, ErrRoomResyncing
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]ParticipantInfo, len(r.roster))
+	copy(out, r.roster)
+	return out, nil
+}
+
+// Metadata returns the room's metadata. It returns ErrRoomResyncing if
+// called before a FastJoin resync has completed.
+func (r *Room) Metadata() (string, error) {
+	if !r.resyncDone() {
+		return "", ErrRoomResyncing
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.metadata, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sip
+
+import (
+	"testing"
+
+	"github.com/frostbyte73/core"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/protocol/logger"
+)
+
+// TestResyncingBlocksStateReads verifies that Participants/Metadata
+// return ErrRoomResyncing during a FastJoin Room's partial-state window,
+// and succeed once the resync completes.
+func TestResyncingBlocksStateReads(t *testing.T) {
+	log := logger.GetLogger()
+	room := NewRoom(log, &RoomStats{})
+
+	// Simulate the partial-state window a FastJoin Connect() would start.
+	room.resyncing = core.Fuse{}
+	require.False(t, room.resyncDone())
+
+	_, err := room.Participants()
+	require.ErrorIs(t, err, ErrRoomResyncing)
+
+	_, err = room.Metadata()
+	require.ErrorIs(t, err, ErrRoomResyncing)
+
+	room.resyncing.Break()
+	require.True(t, room.resyncDone())
+
+	_, err = room.Participants()
+	require.NoError(t, err)
+}
+
+// TestDisconnectDuringResyncDoesNotCloseSIPCall verifies that, like an
+// in-progress migration, a disconnect that happens while a FastJoin Room
+// is still resyncing must not tear down the SIP call. This is the
+// resyncing-fuse analogue of TestMigrationPreventsSIPCallClosure.
+func TestDisconnectDuringResyncDoesNotCloseSIPCall(t *testing.T) {
+	log := logger.GetLogger()
+	room := NewRoom(log, &RoomStats{})
+	room.p = ParticipantInfo{RoomName: "room-a", Identity: "sip-participant"}
+
+	room.resyncing = core.Fuse{}
+	require.False(t, room.resyncDone())
+
+	select {
+	case <-room.stopped.Watch():
+		t.Fatal("stopped fuse should not be broken yet")
+	default:
+	}
+
+	// The OnDisconnected callback registered in Connect() checks
+	// resyncDone() before calling stopped.Break(); simulate that guard
+	// directly here since this test doesn't dial a real SDK room.
+	if !room.migrating.Load() && room.resyncDone() {
+		room.stopped.Break()
+	}
+	select {
+	case <-room.stopped.Watch():
+		t.Fatal("stopped fuse should not be broken while resync is in progress")
+	default:
+	}
+
+	room.resyncing.Break()
+	require.True(t, room.resyncDone(), "resync should be complete after Break")
+}
+
+// TestOnParticipantJoinedAppendsToRoster verifies that participants
+// arriving through the SDK's participant-connected callback (wired in
+// Connect) are recorded in the roster Participants() returns.
+func TestOnParticipantJoinedAppendsToRoster(t *testing.T) {
+	log := logger.GetLogger()
+	room := NewRoom(log, &RoomStats{})
+
+	room.onParticipantJoined(ParticipantInfo{RoomName: "room-a", Identity: "alice"})
+	room.onParticipantJoined(ParticipantInfo{RoomName: "room-a", Identity: "bob"})
+
+	got, err := room.Participants()
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	require.Equal(t, "alice", got[0].Identity)
+	require.Equal(t, "bob", got[1].Identity)
+}
+
+// TestOnParticipantJoinedDedupesByIdentity verifies that a participant who
+// connects during the race window between Connect returning and
+// resyncRoster's GetParticipants() pass is not recorded twice in the
+// roster, since both paths funnel through onParticipantJoined.
+func TestOnParticipantJoinedDedupesByIdentity(t *testing.T) {
+	log := logger.GetLogger()
+	room := NewRoom(log, &RoomStats{})
+
+	room.onParticipantJoined(ParticipantInfo{RoomName: "room-a", Identity: "alice", Name: "Alice"})
+	room.onParticipantJoined(ParticipantInfo{RoomName: "room-a", Identity: "alice", Name: "Alice"})
+
+	got, err := room.Participants()
+	require.NoError(t, err)
+	require.Len(t, got, 1, "the same identity joining twice must not duplicate the roster entry")
+}
+
+// TestOnMetadataChangedPopulatesMetadata verifies that Metadata() returns
+// the value last recorded via onMetadataChanged, which is wired into both
+// resyncRoster's initial seed and the SDK's OnRoomMetadataChanged
+// callback.
+func TestOnMetadataChangedPopulatesMetadata(t *testing.T) {
+	log := logger.GetLogger()
+	room := NewRoom(log, &RoomStats{})
+
+	room.onMetadataChanged(`{"foo":"bar"}`)
+
+	got, err := room.Metadata()
+	require.NoError(t, err)
+	require.Equal(t, `{"foo":"bar"}`, got)
+}
+
+// TestResyncRosterBreaksImmediatelyWithoutRoom verifies that resyncRoster
+// degrades to an immediate Break when called before a real SDK room is
+// attached, as happens in unit tests, instead of hanging.
+func TestResyncRosterBreaksImmediatelyWithoutRoom(t *testing.T) {
+	log := logger.GetLogger()
+	room := NewRoom(log, &RoomStats{})
+	room.resyncing = core.Fuse{}
+
+	room.resyncRoster()
+
+	require.True(t, room.resyncDone())
+}
+
+// Subscribe defers until resync completes.
+func TestSubscribeDeferredUntilResyncComplete(t *testing.T) {
+	log := logger.GetLogger()
+	room := NewRoom(log, &RoomStats{})
+	room.resyncing = core.Fuse{}
+
+	require.NoError(t, room.Subscribe())
+	require.True(t, room.subscribe.Load(), "subscribe intent should be recorded immediately")
+
+	room.resyncing.Break()
+	// Once resync completes, a real Connect() flow calls doSubscribe via
+	// resyncRoster; here we just verify the deferred state was recorded
+	// correctly and doSubscribe is safe to call.
+	require.NoError(t, room.doSubscribe())
+}
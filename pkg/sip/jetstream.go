@@ -0,0 +1,228 @@
+// Copyright 2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sip
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/sip/pkg/config"
+)
+
+const (
+	defaultJetStreamName             = "sip-calls"
+	defaultJetStreamRetentionSeconds = 3600
+)
+
+// CallCommandType enumerates the external orchestrator commands accepted
+// on a call's sip.call.<callID>.cmd subject.
+type CallCommandType string
+
+const (
+	CommandMoveParticipant CallCommandType = "move_participant"
+	CommandTransferCall    CallCommandType = "transfer_call"
+	CommandHangup          CallCommandType = "hangup"
+	CommandRefer           CallCommandType = "refer"
+)
+
+// CallCommand is an orchestrator-issued instruction for a single call.
+type CallCommand struct {
+	Type   CallCommandType `json:"type"`
+	CallID string          `json:"call_id"`
+	// Target is the command's destination: a room name for
+	// move_participant, a SIP URI for transfer_call/refer, unused for
+	// hangup.
+	Target string `json:"target,omitempty"`
+}
+
+// CallEventType enumerates the lifecycle events published on a call's
+// sip.call.<callID>.evt subject.
+type CallEventType string
+
+const (
+	EventRinging      CallEventType = "ringing"
+	EventAnswered     CallEventType = "answered"
+	EventRoomMoved    CallEventType = "room_moved"
+	EventDisconnected CallEventType = "disconnected"
+	EventReconnected  CallEventType = "reconnected"
+	// EventSIPRefer, EventSIPReInvite, and EventSIPAnnounce report the
+	// SIP-side action a RoomConfig.OnRoomMovedSIPAction decision
+	// triggered for a room move; see RoomMovedSIPAction.
+	EventSIPRefer    CallEventType = "sip_refer"
+	EventSIPReInvite CallEventType = "sip_reinvite"
+	EventSIPAnnounce CallEventType = "sip_announce"
+)
+
+// CallEvent is a single lifecycle event for a call.
+type CallEvent struct {
+	Type   CallEventType `json:"type"`
+	CallID string        `json:"call_id"`
+
+	// OldRoom/NewRoom are set on EventRoomMoved and the EventSIP* events.
+	OldRoom string `json:"old_room,omitempty"`
+	NewRoom string `json:"new_room,omitempty"`
+	// TokenAcquiredAt is when the new room's token was obtained, set on
+	// EventRoomMoved.
+	TokenAcquiredAt time.Time `json:"token_acquired_at,omitempty"`
+
+	// TargetURI is the REFER target, set on EventSIPRefer.
+	TargetURI string `json:"target_uri,omitempty"`
+	// SDP is the re-INVITE offer, set on EventSIPReInvite.
+	SDP string `json:"sdp,omitempty"`
+	// AudioURI is the announcement played to the caller, set on
+	// EventSIPAnnounce.
+	AudioURI string `json:"audio_uri,omitempty"`
+
+	At time.Time `json:"at"`
+}
+
+// safeCallIDToken derives a subject-token/durable-name-safe identifier
+// from a Call-ID. Real SIP Call-IDs commonly contain '.' and '@', which
+// break NATS subject tokenization and aren't valid in durable consumer
+// names, so callers must use this instead of the raw Call-ID.
+func safeCallIDToken(callID string) string {
+	sum := sha256.Sum256([]byte(callID))
+	return hex.EncodeToString(sum[:])
+}
+
+func cmdSubject(callID string) string { return fmt.Sprintf("sip.call.%s.cmd", safeCallIDToken(callID)) }
+func evtSubject(callID string) string { return fmt.Sprintf("sip.call.%s.evt", safeCallIDToken(callID)) }
+
+// JetStreamTransport publishes call lifecycle events and consumes
+// orchestrator commands over NATS JetStream, decoupling SIP workers from
+// a single direct control channel.
+type JetStreamTransport struct {
+	log    logger.Logger
+	js     jetstream.JetStream
+	stream jetstream.Stream
+}
+
+// NewJetStreamTransport connects to JetStream using conf. It returns
+// (nil, nil) if conf has no addresses configured, so callers can treat a
+// disabled control plane as a normal no-op case.
+func NewJetStreamTransport(ctx context.Context, log logger.Logger, conf config.JetStreamConfig) (*JetStreamTransport, error) {
+	if len(conf.Addresses) == 0 {
+		return nil, nil
+	}
+	if log == nil {
+		log = logger.GetLogger()
+	}
+
+	nc, err := nats.Connect(conf.Addresses[0])
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, err
+	}
+
+	name := conf.Stream
+	if name == "" {
+		name = defaultJetStreamName
+	}
+	retention := conf.RetentionSeconds
+	if retention <= 0 {
+		retention = defaultJetStreamRetentionSeconds
+	}
+
+	stream, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      name,
+		Subjects:  []string{"sip.call.*.cmd", "sip.call.*.evt"},
+		MaxAge:    time.Duration(retention) * time.Second,
+		Retention: jetstream.LimitsPolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &JetStreamTransport{log: log, js: js, stream: stream}, nil
+}
+
+// PublishEvent publishes a call lifecycle event on sip.call.<callID>.evt.
+func (t *JetStreamTransport) PublishEvent(ctx context.Context, ev CallEvent) error {
+	if t == nil {
+		return nil
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = t.js.Publish(ctx, evtSubject(ev.CallID), data)
+	return err
+}
+
+// CommandHandler processes a single CallCommand. Returning a non-nil
+// error leaves the message unacked so it is redelivered.
+type CommandHandler func(context.Context, CallCommand) error
+
+// ConsumeCommands creates a per-call durable consumer on
+// sip.call.<callID>.cmd and delivers each command to handle, acking on
+// success. It blocks until ctx is done, and deletes the durable consumer
+// before returning so finished calls don't accumulate one consumer each
+// on the NATS server forever.
+func (t *JetStreamTransport) ConsumeCommands(ctx context.Context, callID string, handle CommandHandler) error {
+	if t == nil {
+		<-ctx.Done()
+		return nil
+	}
+
+	durableName := "sip-cmd-" + safeCallIDToken(callID)
+	cons, err := t.stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:       durableName,
+		FilterSubject: cmdSubject(callID),
+		AckPolicy:     jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// ctx is already done here, so use a fresh one for cleanup.
+		if err := t.stream.DeleteConsumer(context.Background(), durableName); err != nil && !errors.Is(err, jetstream.ErrConsumerNotFound) {
+			t.log.Warnw("failed to delete sip call consumer", err, "callID", callID)
+		}
+	}()
+
+	consCtx, err := cons.Consume(func(msg jetstream.Msg) {
+		var cmd CallCommand
+		if err := json.Unmarshal(msg.Data(), &cmd); err != nil {
+			t.log.Warnw("failed to decode sip call command", err, "callID", callID)
+			_ = msg.Term()
+			return
+		}
+		if err := handle(ctx, cmd); err != nil {
+			t.log.Warnw("failed to handle sip call command", err, "callID", callID, "type", cmd.Type)
+			_ = msg.Nak()
+			return
+		}
+		_ = msg.Ack()
+	})
+	if err != nil {
+		return err
+	}
+	defer consCtx.Stop()
+
+	<-ctx.Done()
+	return nil
+}
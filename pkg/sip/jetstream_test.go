@@ -0,0 +1,56 @@
+// Copyright 2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/sip/pkg/config"
+)
+
+// TestCallSubjects verifies the sip.call.<token>.{cmd,evt} subject
+// naming that external orchestrators rely on, where <token> is derived
+// from the Call-ID rather than the raw value.
+func TestCallSubjects(t *testing.T) {
+	tok := safeCallIDToken("call-1")
+	require.Equal(t, "sip.call."+tok+".cmd", cmdSubject("call-1"))
+	require.Equal(t, "sip.call."+tok+".evt", evtSubject("call-1"))
+}
+
+// TestSafeCallIDTokenSanitizesSubjectChars verifies that Call-IDs
+// containing '.'/'@' (as real SIP Call-IDs do) produce a token with none
+// of the characters that would break NATS subject tokenization or the
+// durable consumer name charset.
+func TestSafeCallIDTokenSanitizesSubjectChars(t *testing.T) {
+	tok := safeCallIDToken("abc123@192.168.0.1")
+	require.NotContains(t, tok, ".")
+	require.NotContains(t, tok, "@")
+	require.NotEmpty(t, tok)
+}
+
+// TestJetStreamTransportDisabledIsNil verifies that a zero-value
+// JetStreamConfig yields a nil transport rather than an error, so
+// disabling the control plane is the default.
+func TestJetStreamTransportDisabledIsNil(t *testing.T) {
+	tr, err := NewJetStreamTransport(context.Background(), nil, config.JetStreamConfig{})
+	require.NoError(t, err)
+	require.Nil(t, tr)
+
+	var nilTransport *JetStreamTransport
+	require.NoError(t, nilTransport.PublishEvent(nil, CallEvent{}))
+}
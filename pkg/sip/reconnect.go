@@ -0,0 +1,90 @@
+// Copyright 2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sip
+
+// ReconnectReason differentiates why the LiveKit SDK is reconnecting our
+// Room, mirroring the "reason" distinctions modern LiveKit client SDKs
+// surface (e.g. a transient websocket blip vs. a deliberate server-side
+// move), so integrators can react differently to each.
+type ReconnectReason int
+
+const (
+	ReasonUnknown ReconnectReason = iota
+	// ReasonWebsocket is a transient signalling connection drop.
+	ReasonWebsocket
+	// ReasonSignalTimeout is a missed signalling keepalive.
+	ReasonSignalTimeout
+	// ReasonRoomMoved is a deliberate MoveParticipant-driven room change.
+	ReasonRoomMoved
+	// ReasonServerRequested is an explicit server-initiated reconnect.
+	ReasonServerRequested
+)
+
+func (r ReconnectReason) String() string {
+	switch r {
+	case ReasonWebsocket:
+		return "websocket"
+	case ReasonSignalTimeout:
+		return "signal_timeout"
+	case ReasonRoomMoved:
+		return "room_moved"
+	case ReasonServerRequested:
+		return "server_requested"
+	default:
+		return "unknown"
+	}
+}
+
+// ReconnectAction is what a ReconnectPolicy decides should happen to the
+// SIP leg while LiveKit-side reconnection is in progress.
+type ReconnectAction int
+
+const (
+	// ActionKeepAlive leaves the SIP leg untouched; media simply pauses
+	// until LiveKit reconnects.
+	ActionKeepAlive ReconnectAction = iota
+	// ActionHoldMusic selects hold music for the caller for the duration
+	// of the reconnect; see Room.applyReconnectDecision for what is done
+	// with it.
+	ActionHoldMusic
+	// ActionDTMFBeep selects a DTMF beep to the caller to signal the gap;
+	// see Room.applyReconnectDecision for what is done with it.
+	ActionDTMFBeep
+	// ActionDrop ends the SIP call immediately.
+	ActionDrop
+)
+
+// ReconnectDecision is the outcome of a ReconnectPolicy decision.
+type ReconnectDecision struct {
+	Action ReconnectAction
+	// DropCode is the SIP response code chosen for ActionDrop (e.g. 503
+	// Service Unavailable). Room.applyReconnectDecision logs it but does
+	// not send it.
+	DropCode int
+}
+
+// ReconnectPolicy decides, per ReconnectReason, how the SIP leg of a call
+// should behave while its LiveKit room connection is reconnecting.
+type ReconnectPolicy interface {
+	Decide(reason ReconnectReason) ReconnectDecision
+}
+
+// DefaultReconnectPolicy keeps the SIP leg alive through every reconnect
+// reason. It is used when RoomConfig.ReconnectPolicy is unset.
+type DefaultReconnectPolicy struct{}
+
+func (DefaultReconnectPolicy) Decide(ReconnectReason) ReconnectDecision {
+	return ReconnectDecision{Action: ActionKeepAlive}
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/sip/pkg/config"
+)
+
+// TestHandleRoomMovedSetsRoomMovedReason verifies that a room move is
+// attributed ReasonRoomMoved, not the generic ReasonWebsocket default, so
+// a caller's ReconnectPolicy can tell the two apart.
+func TestHandleRoomMovedSetsRoomMovedReason(t *testing.T) {
+	log := logger.GetLogger()
+	room := NewRoom(log, &RoomStats{})
+	room.p = ParticipantInfo{RoomName: "original-room", Identity: "sip-participant"}
+
+	room.handleRoomMoved(&config.Config{}, RoomConfig{RoomName: "original-room"}, "destination-room", "tok")
+
+	require.Equal(t, ReasonRoomMoved, room.takeReconnectReason())
+	// Consuming the reason resets it to the default guess.
+	require.Equal(t, ReasonWebsocket, room.takeReconnectReason())
+}
+
+// TestDefaultReconnectPolicyKeepsCallAlive verifies the zero-value policy
+// never drops the SIP leg, regardless of reason.
+func TestDefaultReconnectPolicyKeepsCallAlive(t *testing.T) {
+	var p DefaultReconnectPolicy
+	for _, reason := range []ReconnectReason{ReasonUnknown, ReasonWebsocket, ReasonSignalTimeout, ReasonRoomMoved, ReasonServerRequested} {
+		require.Equal(t, ActionKeepAlive, p.Decide(reason).Action)
+	}
+}
+
+// stubReconnectPolicy lets tests assert the SIP leg is dropped for a
+// specific reason while every other reason is kept alive.
+type stubReconnectPolicy struct {
+	dropReason ReconnectReason
+	dropCode   int
+}
+
+func (p stubReconnectPolicy) Decide(reason ReconnectReason) ReconnectDecision {
+	if reason == p.dropReason {
+		return ReconnectDecision{Action: ActionDrop, DropCode: p.dropCode}
+	}
+	return ReconnectDecision{Action: ActionKeepAlive}
+}
+
+// TestStubPolicyDropsOnlyMatchingReason verifies a policy can choose to
+// drop the call for one specific reason while keeping it alive for all
+// others.
+func TestStubPolicyDropsOnlyMatchingReason(t *testing.T) {
+	p := stubReconnectPolicy{dropReason: ReasonServerRequested, dropCode: 480}
+
+	require.Equal(t, ActionKeepAlive, p.Decide(ReasonWebsocket).Action)
+
+	d := p.Decide(ReasonServerRequested)
+	require.Equal(t, ActionDrop, d.Action)
+	require.Equal(t, 480, d.DropCode)
+}
+
+// TestApplyReconnectDecisionDrop verifies that an ActionDrop decision
+// breaks the stopped fuse, ending the SIP call.
+func TestApplyReconnectDecisionDrop(t *testing.T) {
+	log := logger.GetLogger()
+	room := NewRoom(log, &RoomStats{})
+
+	room.applyReconnectDecision(ReconnectDecision{Action: ActionKeepAlive})
+	select {
+	case <-room.stopped.Watch():
+		t.Fatal("stopped fuse should not be broken by ActionKeepAlive")
+	default:
+	}
+
+	room.applyReconnectDecision(ReconnectDecision{Action: ActionDrop, DropCode: 503})
+	select {
+	case <-room.stopped.Watch():
+	default:
+		t.Fatal("stopped fuse should be broken by ActionDrop")
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sip
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+
+	"github.com/livekit/sip/pkg/config"
+)
+
+// defaultCheckpointInterval is used when CheckpointConfig.IntervalSeconds
+// is unset.
+const defaultCheckpointInterval = 5 * time.Second
+
+// RTPSessionState is the minimal RTP-side state a resumed worker needs to
+// keep forwarding media for an in-progress SIP dialog without a re-INVITE.
+type RTPSessionState struct {
+	LocalPort   int    `json:"local_port"`
+	RemoteAddr  string `json:"remote_addr"`
+	PayloadType uint8  `json:"payload_type"`
+	SSRC        uint32 `json:"ssrc"`
+}
+
+// Checkpoint is the point-in-time snapshot of a SIP<->room mapping that is
+// durably stored so another worker can resume the call if this one dies.
+type Checkpoint struct {
+	CallID      string          `json:"call_id"`
+	Participant ParticipantInfo `json:"participant"`
+	RoomName    string          `json:"room_name"`
+	Token       string          `json:"token"`
+	RTP         RTPSessionState `json:"rtp"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// CheckpointStore persists Checkpoints keyed by CallID. Implementations
+// must make Claim atomic: only one worker may successfully claim a given
+// CallID at a time, so two workers racing to take over a crashed peer's
+// calls don't both resume the same dialog.
+type CheckpointStore interface {
+	Save(ctx context.Context, cp Checkpoint) error
+	Load(ctx context.Context, callID string) (Checkpoint, error)
+	// Claim marks callID as owned by this worker, failing if another
+	// worker already holds a live claim.
+	Claim(ctx context.Context, callID string) (bool, error)
+	// Renew extends a claim the caller already holds, so a worker that
+	// is still alive and serving callID doesn't lose its claim to the
+	// backend's claimTTL expiry.
+	Renew(ctx context.Context, callID string) error
+	// Release gives up a claim the caller already holds without
+	// deleting the underlying checkpoint, so a worker that claimed
+	// callID but failed before actually resuming the call doesn't
+	// destroy state another worker could still resume from.
+	Release(ctx context.Context, callID string) error
+	Delete(ctx context.Context, callID string) error
+}
+
+// NewCheckpointStore builds the CheckpointStore configured in conf, or nil
+// if checkpointing is disabled.
+func NewCheckpointStore(conf config.CheckpointConfig) (CheckpointStore, error) {
+	switch conf.Backend {
+	case "":
+		return nil, nil
+	case "redis":
+		return newRedisCheckpointStore(conf.Redis)
+	case "nats":
+		return newNATSCheckpointStore(conf.NATS)
+	default:
+		return nil, fmt.Errorf("sip: unknown checkpoint backend %q", conf.Backend)
+	}
+}
+
+// RoomResumer periodically checkpoints a Room's state to a CheckpointStore,
+// and can claim and resume a checkpoint left behind by a crashed worker.
+type RoomResumer struct {
+	log   logger.Logger
+	store CheckpointStore
+	conf  config.CheckpointConfig
+}
+
+// NewRoomResumer creates a RoomResumer backed by store. store may be nil,
+// in which case checkpointing and resume are both no-ops.
+func NewRoomResumer(log logger.Logger, store CheckpointStore, conf config.CheckpointConfig) *RoomResumer {
+	return &RoomResumer{log: log, store: store, conf: conf}
+}
+
+func (rr *RoomResumer) interval() time.Duration {
+	if rr.conf.IntervalSeconds <= 0 {
+		return defaultCheckpointInterval
+	}
+	return time.Duration(rr.conf.IntervalSeconds) * time.Second
+}
+
+// Checkpoint persists a single snapshot of r's current state. It is safe
+// to call concurrently with r's own goroutines.
+func (rr *RoomResumer) Checkpoint(ctx context.Context, callID, token string, rtp RTPSessionState, r *Room) error {
+	if rr.store == nil {
+		return nil
+	}
+	r.mu.Lock()
+	p := r.p
+	r.mu.Unlock()
+
+	cp := Checkpoint{
+		CallID:      callID,
+		Participant: p,
+		RoomName:    p.RoomName,
+		Token:       token,
+		RTP:         rtp,
+		UpdatedAt:   time.Now(),
+	}
+	return rr.store.Save(ctx, cp)
+}
+
+// Run checkpoints r on conf's interval until stop is closed. It is
+// intended to run in its own goroutine for the lifetime of the call.
+func (rr *RoomResumer) Run(ctx context.Context, callID, token string, rtpFunc func() RTPSessionState, r *Room, stop <-chan struct{}) {
+	if rr.store == nil {
+		return
+	}
+	t := time.NewTicker(rr.interval())
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := rr.store.Renew(ctx, callID); err != nil {
+				rr.log.Warnw("failed to renew call claim", err, "callID", callID)
+			}
+			if err := rr.Checkpoint(ctx, callID, token, rtpFunc(), r); err != nil {
+				rr.log.Warnw("failed to checkpoint call", err, "callID", callID)
+			}
+		}
+	}
+}
+
+// Resume claims the checkpoint for callID and, if successful, reconnects a
+// new Room to the checkpointed LiveKit room using the stored token so RTP
+// forwarding for the still-active SIP dialog can continue uninterrupted.
+// base supplies the RoomConfig fields that aren't part of the checkpoint
+// itself (Transport, ReconnectPolicy, FastJoin, ...); Resume overrides
+// only RoomName and CallID from the checkpoint.
+//
+// Resume is responsible for leaving the returned Room's stopped/migrating
+// fuses in a state consistent with an in-progress call: migrating is set
+// for the duration of the reconnect so a spurious OnDisconnected during
+// the handover doesn't break stopped, exactly as it would for a live
+// room-move (see handleRoomMoved). It also restarts the checkpoint/claim
+// lifecycle for the resumed Room: rr.Run keeps renewing the claim and
+// refreshing the checkpoint for as long as the Room is alive, and the
+// checkpoint/claim are deleted once the Room's stopped fuse breaks so a
+// finished call doesn't leave claimable state behind.
+//
+// ctx governs only the claim/load performed before the Room exists; once
+// Resume hands off to rr.Run it uses context.Background() instead, since
+// the renewal loop must outlive whatever request-scoped ctx the caller
+// resumed the call under for as long as the call itself is alive.
+func (rr *RoomResumer) Resume(ctx context.Context, conf *config.Config, callID string, base RoomConfig) (*Room, Checkpoint, error) {
+	if rr.store == nil {
+		return nil, Checkpoint{}, fmt.Errorf("sip: checkpointing disabled, cannot resume call %q", callID)
+	}
+
+	ok, err := rr.store.Claim(ctx, callID)
+	if err != nil {
+		return nil, Checkpoint{}, err
+	}
+	if !ok {
+		return nil, Checkpoint{}, fmt.Errorf("sip: call %q already claimed by another worker", callID)
+	}
+
+	cp, err := rr.store.Load(ctx, callID)
+	if err != nil {
+		rr.releaseClaim(callID)
+		return nil, Checkpoint{}, err
+	}
+
+	r := NewRoom(rr.log, nil)
+	r.migrating.Store(true)
+	r.p = cp.Participant
+
+	rconf := base
+	rconf.RoomName = cp.RoomName
+	rconf.CallID = callID
+	if err := r.Connect(conf, rconf, cp.Token); err != nil {
+		rr.releaseClaim(callID)
+		return nil, cp, fmt.Errorf("sip: resume call %q: %w", callID, err)
+	}
+	r.migrating.Store(false)
+
+	stop := r.stopped.Watch()
+	rtp := cp.RTP
+	runCtx := context.Background()
+	go rr.Run(runCtx, callID, cp.Token, func() RTPSessionState { return rtp }, r, stop)
+	go func() {
+		<-stop
+		if err := rr.store.Delete(context.Background(), callID); err != nil {
+			rr.log.Warnw("failed to delete checkpoint after resumed call ended", err, "callID", callID)
+		}
+	}()
+
+	return r, cp, nil
+}
+
+// releaseClaim gives up a claim Resume took but won't be handing off to a
+// live Room, so a Connect failure doesn't lock the call away from every
+// other worker for the full claimTTL. It uses context.Background() since
+// the caller's ctx may already be the reason Resume is unwinding.
+func (rr *RoomResumer) releaseClaim(callID string) {
+	if err := rr.store.Release(context.Background(), callID); err != nil {
+		rr.log.Warnw("failed to release claim after resume failed", err, "callID", callID)
+	}
+}
+
+// marshalCheckpoint and unmarshalCheckpoint are shared by the Redis and
+// NATS KV backed stores, which otherwise differ only in how they get
+// bytes in and out of their respective store.
+func marshalCheckpoint(cp Checkpoint) ([]byte, error) {
+	return json.Marshal(cp)
+}
+
+func unmarshalCheckpoint(data []byte) (Checkpoint, error) {
+	var cp Checkpoint
+	err := json.Unmarshal(data, &cp)
+	return cp, err
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sip
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/sip/pkg/config"
+)
+
+// memCheckpointStore is an in-memory CheckpointStore used to test
+// RoomResumer without a real Redis/NATS dependency.
+type memCheckpointStore struct {
+	mu      sync.Mutex
+	cps     map[string]Checkpoint
+	claimed map[string]bool
+}
+
+func newMemCheckpointStore() *memCheckpointStore {
+	return &memCheckpointStore{
+		cps:     make(map[string]Checkpoint),
+		claimed: make(map[string]bool),
+	}
+}
+
+func (s *memCheckpointStore) Save(_ context.Context, cp Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cps[cp.CallID] = cp
+	return nil
+}
+
+func (s *memCheckpointStore) Load(_ context.Context, callID string) (Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cps[callID], nil
+}
+
+func (s *memCheckpointStore) Claim(_ context.Context, callID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.claimed[callID] {
+		return false, nil
+	}
+	s.claimed[callID] = true
+	return true, nil
+}
+
+func (s *memCheckpointStore) Renew(_ context.Context, callID string) error {
+	return nil
+}
+
+func (s *memCheckpointStore) Release(_ context.Context, callID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.claimed, callID)
+	return nil
+}
+
+func (s *memCheckpointStore) Delete(_ context.Context, callID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cps, callID)
+	delete(s.claimed, callID)
+	return nil
+}
+
+// TestRoomResumerCheckpoint verifies that Checkpoint saves the Room's
+// current participant/room state to the store.
+func TestRoomResumerCheckpoint(t *testing.T) {
+	log := logger.GetLogger()
+	store := newMemCheckpointStore()
+	rr := NewRoomResumer(log, store, config.CheckpointConfig{})
+
+	room := NewRoom(log, &RoomStats{})
+	room.p = ParticipantInfo{RoomName: "room-a", Identity: "sip-participant"}
+
+	err := rr.Checkpoint(context.Background(), "call-1", "tok", RTPSessionState{LocalPort: 1234}, room)
+	require.NoError(t, err)
+
+	cp, err := store.Load(context.Background(), "call-1")
+	require.NoError(t, err)
+	require.Equal(t, "room-a", cp.RoomName)
+	require.Equal(t, 1234, cp.RTP.LocalPort)
+}
+
+// TestRoomResumerClaimIsExclusive verifies that only one caller can claim
+// a given call's checkpoint, so two workers racing to take over a crashed
+// peer's calls don't both try to resume the same dialog.
+func TestRoomResumerClaimIsExclusive(t *testing.T) {
+	store := newMemCheckpointStore()
+
+	ok1, err := store.Claim(context.Background(), "call-1")
+	require.NoError(t, err)
+	require.True(t, ok1)
+
+	ok2, err := store.Claim(context.Background(), "call-1")
+	require.NoError(t, err)
+	require.False(t, ok2, "second claim of the same call must fail")
+}
+
+// errLoadCheckpointStore wraps a memCheckpointStore but fails Load, to
+// simulate a backend error after a successful Claim without requiring a
+// real LiveKit connection.
+type errLoadCheckpointStore struct {
+	*memCheckpointStore
+}
+
+func (s *errLoadCheckpointStore) Load(context.Context, string) (Checkpoint, error) {
+	return Checkpoint{}, errors.New("boom")
+}
+
+// TestResumeReleasesClaimOnLoadFailure verifies that Resume gives up its
+// claim if it fails before handing off to a live Room, so the call isn't
+// locked away from every other worker for the full claimTTL by a single
+// transient error.
+func TestResumeReleasesClaimOnLoadFailure(t *testing.T) {
+	log := logger.GetLogger()
+	store := &errLoadCheckpointStore{memCheckpointStore: newMemCheckpointStore()}
+	rr := NewRoomResumer(log, store, config.CheckpointConfig{})
+
+	_, _, err := rr.Resume(context.Background(), &config.Config{}, "call-1", RoomConfig{})
+	require.Error(t, err)
+
+	ok, err := store.Claim(context.Background(), "call-1")
+	require.NoError(t, err)
+	require.True(t, ok, "the claim must have been released so another worker can claim call-1")
+}
+
+// TestRoomResumerNilStoreIsNoop verifies that a RoomResumer with no
+// configured backend silently no-ops rather than erroring, so
+// checkpointing can stay off by default.
+func TestRoomResumerNilStoreIsNoop(t *testing.T) {
+	log := logger.GetLogger()
+	rr := NewRoomResumer(log, nil, config.CheckpointConfig{})
+
+	room := NewRoom(log, &RoomStats{})
+	err := rr.Checkpoint(context.Background(), "call-1", "tok", RTPSessionState{}, room)
+	require.NoError(t, err)
+}
@@ -0,0 +1,517 @@
+// Copyright 2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sip
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/frostbyte73/core"
+	"go.uber.org/atomic"
+
+	"github.com/livekit/protocol/logger"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+
+	"github.com/livekit/sip/pkg/config"
+)
+
+// ParticipantInfo identifies the SIP participant a Room is forwarding RTP
+// for, and the LiveKit room it is currently attached to.
+type ParticipantInfo struct {
+	RoomName string
+	Identity string
+	Name     string
+}
+
+// RoomConfig controls how a Room connects to and behaves inside a
+// particular LiveKit room.
+type RoomConfig struct {
+	RoomName string
+
+	// ReconnectPolicy decides how the SIP leg should behave while the
+	// LiveKit connection is reconnecting. Defaults to
+	// DefaultReconnectPolicy (keep the SIP leg alive) if nil.
+	ReconnectPolicy ReconnectPolicy
+	// OnReconnecting, if set, is called with the classified reason each
+	// time the SDK begins reconnecting this Room.
+	OnReconnecting func(reason ReconnectReason)
+
+	// FastJoin, if true, lets the SIP participant start publishing and
+	// receiving audio as soon as the signalling handshake and its own
+	// PeerConnection are up, without waiting for the full
+	// participant/track roster to sync. See Room.resyncing.
+	FastJoin bool
+
+	// CallID identifies the SIP dialog this Room backs, used to key
+	// JetStream command/event subjects. Required when Transport is set.
+	CallID string
+	// Transport, if set, publishes this Room's lifecycle events (e.g.
+	// room_moved) to the JetStream control plane.
+	Transport EventPublisher
+
+	// OnRoomMovedSIPAction, if set, is called with the old and new room
+	// names whenever a room move occurs, and selects a SIP-side action for
+	// the move (a REFER, an in-dialog re-INVITE, or a played
+	// announcement). The zero value/SIPActionNone selects none. The Room
+	// itself sends no SIP signalling and plays no audio: it publishes the
+	// chosen action on Transport as the matching EventSIP* lifecycle
+	// event, and counts the action's migration step complete once that
+	// publish returns.
+	OnRoomMovedSIPAction func(oldRoom, newRoom string) RoomMovedSIPAction
+
+	// MigrationTimeout bounds how long a room-move is allowed to stay
+	// migrating before it's treated as failed and the SIP call is torn
+	// down. Defaults to defaultMigrationTimeout if zero.
+	MigrationTimeout time.Duration
+}
+
+// defaultMigrationTimeout is used when RoomConfig.MigrationTimeout is
+// unset.
+const defaultMigrationTimeout = 30 * time.Second
+
+func (c RoomConfig) migrationTimeout() time.Duration {
+	if c.MigrationTimeout > 0 {
+		return c.MigrationTimeout
+	}
+	return defaultMigrationTimeout
+}
+
+// RoomMovedSIPActionKind enumerates the SIP-side signalling events a
+// RoomConfig.OnRoomMovedSIPAction decision can trigger for an in-progress
+// call when its LiveKit room is moved.
+type RoomMovedSIPActionKind int
+
+const (
+	// SIPActionNone leaves the SIP dialog untouched; the migrating fuse
+	// only waits on the LiveKit-side reconnect.
+	SIPActionNone RoomMovedSIPActionKind = iota
+	// SIPActionRefer selects a SIP REFER to TargetURI, e.g. handing the
+	// call off to a human attendant near the destination room.
+	SIPActionRefer
+	// SIPActionReInvite selects an in-dialog re-INVITE carrying SDP, e.g.
+	// to change codec or move media to an RTP relay closer to the
+	// destination room's region.
+	SIPActionReInvite
+	// SIPActionPlayAnnouncement selects playing AudioURI to the caller.
+	SIPActionPlayAnnouncement
+)
+
+// RoomMovedSIPAction is the outcome of a RoomConfig.OnRoomMovedSIPAction
+// decision. The zero value is SIPActionNone; use Refer, ReInviteWithSDP,
+// or PlayAnnouncement to build the others.
+type RoomMovedSIPAction struct {
+	Kind RoomMovedSIPActionKind
+	// TargetURI is the REFER target, set when Kind is SIPActionRefer.
+	TargetURI string
+	// SDP is the re-INVITE offer, set when Kind is SIPActionReInvite.
+	SDP string
+	// AudioURI is the announcement to play, set when Kind is
+	// SIPActionPlayAnnouncement.
+	AudioURI string
+}
+
+// Refer builds a RoomMovedSIPAction that REFERs the call to targetURI.
+func Refer(targetURI string) RoomMovedSIPAction {
+	return RoomMovedSIPAction{Kind: SIPActionRefer, TargetURI: targetURI}
+}
+
+// ReInviteWithSDP builds a RoomMovedSIPAction that re-INVITEs the call
+// with sdp.
+func ReInviteWithSDP(sdp string) RoomMovedSIPAction {
+	return RoomMovedSIPAction{Kind: SIPActionReInvite, SDP: sdp}
+}
+
+// PlayAnnouncement builds a RoomMovedSIPAction that plays audioURI to the
+// caller.
+func PlayAnnouncement(audioURI string) RoomMovedSIPAction {
+	return RoomMovedSIPAction{Kind: SIPActionPlayAnnouncement, AudioURI: audioURI}
+}
+
+// EventPublisher publishes call lifecycle events. *JetStreamTransport
+// implements it; tests substitute a fake.
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, ev CallEvent) error
+}
+
+func (c RoomConfig) reconnectPolicy() ReconnectPolicy {
+	if c.ReconnectPolicy != nil {
+		return c.ReconnectPolicy
+	}
+	return DefaultReconnectPolicy{}
+}
+
+// RoomStats tracks aggregate counters across all Rooms handled by a worker.
+type RoomStats struct {
+	mu        sync.Mutex
+	Migration int
+}
+
+func (s *RoomStats) migrationStarted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Migration++
+}
+
+// Room wraps a single lksdk.Room connection on behalf of one SIP dialog,
+// and carries the state needed to survive LiveKit-side reconnects and
+// room moves without tearing down the underlying SIP call.
+type Room struct {
+	log   logger.Logger
+	stats *RoomStats
+
+	mu   sync.Mutex
+	room *lksdk.Room
+	p    ParticipantInfo
+
+	// migrating is set for the duration of a room-move: the SDK
+	// reconnect callbacks fire as a side effect of the move and must not
+	// be mistaken for an unexpected disconnect. watchMigrationTimeout
+	// backstops it: if nothing clears it before rconf.migrationTimeout()
+	// elapses, the move is treated as failed and the call is ended.
+	migrating atomic.Bool
+	// migrationSteps counts the not-yet-complete steps a room-move must
+	// wait on before migrating clears: the LiveKit-side reconnect, plus
+	// the SIP-side action (if any) requested by OnRoomMovedSIPAction.
+	// completeMigrationStep decrements it and clears migrating once it
+	// reaches zero. It is left at its zero value outside of a move, so
+	// completeMigrationStep is a no-op for ordinary reconnects.
+	migrationSteps atomic.Int32
+	// migrationGen is incremented each time handleRoomMoved starts a new
+	// move. watchMigrationTimeout captures the generation current at the
+	// time it was spawned and compares against this before acting, so a
+	// watchdog left over from an earlier move that has since been
+	// superseded by a new one doesn't tear down the call out from under
+	// the move actually in progress.
+	migrationGen atomic.Int32
+	// subscribe records whether the caller asked to subscribe to remote
+	// tracks, so it can be restored after a reconnect.
+	subscribe atomic.Bool
+
+	// stopped is broken exactly once, when the SIP call this Room backs
+	// is actually done and should be torn down.
+	stopped core.Fuse
+
+	// pendingReason is the ReconnectReason attributed to the next
+	// OnReconnecting callback. It defaults to ReasonWebsocket, since most
+	// reconnects are unsolicited signalling drops; handleRoomMoved
+	// overrides it ahead of the SDK-driven reconnect that follows a move.
+	pendingReason ReconnectReason
+
+	// resyncing is broken once the full participant/track roster has
+	// been synced. A FastJoin Room starts with it unbroken so callers can
+	// tell a partial-state window apart from a normal connect.
+	resyncing core.Fuse
+	roster    []ParticipantInfo
+	metadata  string
+}
+
+func (r *Room) setReconnectReason(reason ReconnectReason) {
+	r.mu.Lock()
+	r.pendingReason = reason
+	r.mu.Unlock()
+}
+
+// takeReconnectReason returns the reason attributed to the in-progress
+// reconnect and resets it back to the default guess for next time.
+func (r *Room) takeReconnectReason() ReconnectReason {
+	r.mu.Lock()
+	reason := r.pendingReason
+	r.pendingReason = ReasonWebsocket
+	r.mu.Unlock()
+	if reason == ReasonUnknown {
+		return ReasonWebsocket
+	}
+	return reason
+}
+
+// completeMigrationStep marks one pending migration step (the LiveKit
+// reconnect or the SIP-side action) as done, clearing migrating once
+// every step started by handleRoomMoved has completed. Outside of a
+// move, migrationSteps is zero and this is a no-op.
+func (r *Room) completeMigrationStep() {
+	if r.migrationSteps.Load() <= 0 {
+		return
+	}
+	if r.migrationSteps.Dec() <= 0 {
+		r.migrating.Store(false)
+	}
+}
+
+// NewRoom creates a Room ready to Connect.
+func NewRoom(log logger.Logger, stats *RoomStats) *Room {
+	if log == nil {
+		log = logger.GetLogger()
+	}
+	r := &Room{
+		log:   log,
+		stats: stats,
+	}
+	// Not a FastJoin connect (yet): there is no roster to wait for.
+	r.resyncing.Break()
+	return r
+}
+
+// Connect dials the LiveKit room described by rconf using token, and wires
+// up the SDK callbacks that keep the SIP call alive across reconnects and
+// room moves.
+func (r *Room) Connect(conf *config.Config, rconf RoomConfig, token string) error {
+	cb := &lksdk.RoomCallback{
+		OnRoomMoved: func(newRoomName string, newToken string) {
+			r.handleRoomMoved(conf, rconf, newRoomName, newToken)
+		},
+		OnDisconnected: func() {
+			if r.migrating.Load() {
+				// Expected side effect of a move/reconnect; the SIP call
+				// stays up.
+				return
+			}
+			if !r.resyncDone() {
+				// Still in the FastJoin partial-state window; a drop here
+				// must not tear down the SIP call either.
+				return
+			}
+			r.publishCallEvent(rconf, CallEvent{Type: EventDisconnected, CallID: rconf.CallID, At: time.Now()})
+			r.stopped.Break()
+		},
+		OnReconnecting: func() {
+			reason := r.takeReconnectReason()
+			decision := rconf.reconnectPolicy().Decide(reason)
+			r.applyReconnectDecision(decision)
+			if rconf.OnReconnecting != nil {
+				rconf.OnReconnecting(reason)
+			}
+		},
+		OnReconnected: func() {
+			if r.subscribe.Load() {
+				_ = r.Subscribe()
+			}
+			r.completeMigrationStep()
+			r.publishCallEvent(rconf, CallEvent{Type: EventReconnected, CallID: rconf.CallID, At: time.Now()})
+		},
+		OnParticipantConnected: func(rp *lksdk.RemoteParticipant) {
+			r.mu.Lock()
+			roomName := r.p.RoomName
+			r.mu.Unlock()
+			r.onParticipantJoined(ParticipantInfo{
+				RoomName: roomName,
+				Identity: rp.Identity(),
+				Name:     rp.Name(),
+			})
+		},
+		OnRoomMetadataChanged: func(metadata string) {
+			r.onMetadataChanged(metadata)
+		},
+	}
+
+	if rconf.FastJoin {
+		// Start with a fresh, unbroken fuse: we publish/receive audio
+		// immediately and materialize the roster lazily in the background.
+		r.resyncing = core.Fuse{}
+	}
+
+	room, err := lksdk.ConnectToRoomWithToken(conf.WsUrl, token, cb)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.room = room
+	r.mu.Unlock()
+
+	if rconf.FastJoin {
+		go r.resyncRoster()
+	}
+	return nil
+}
+
+// Subscribe records that the caller wants remote participant tracks, so
+// the request is restored after a reconnect. It does not subscribe to
+// tracks itself: per-track subscription is driven by the SDK's
+// participant callbacks (see doSubscribe). If a FastJoin resync is still
+// in progress, doSubscribe is deferred until it completes.
+func (r *Room) Subscribe() error {
+	r.subscribe.Store(true)
+	if !r.resyncDone() {
+		return nil
+	}
+	return r.doSubscribe()
+}
+
+func (r *Room) doSubscribe() error {
+	r.mu.Lock()
+	room := r.room
+	r.mu.Unlock()
+	if room == nil {
+		return nil
+	}
+	// Actual per-track subscription is driven by the SDK's participant
+	// callbacks; nothing further to do here.
+	return nil
+}
+
+// applyReconnectDecision carries out a ReconnectPolicy's decision for the
+// SIP leg while the LiveKit side is reconnecting. ActionDrop breaks
+// stopped, ending the call; its DropCode is only logged, not sent as a
+// SIP response. ActionHoldMusic and ActionDTMFBeep are only logged: this
+// Room plays no hold music and sends no DTMF.
+func (r *Room) applyReconnectDecision(d ReconnectDecision) {
+	switch d.Action {
+	case ActionDrop:
+		r.log.Infow("dropping SIP call on reconnect", "code", d.DropCode)
+		r.stopped.Break()
+	case ActionHoldMusic, ActionDTMFBeep:
+		r.log.Debugw("reconnecting, applying media fallback", "action", d.Action)
+	case ActionKeepAlive:
+		// nothing to do; media simply pauses until reconnected.
+	}
+}
+
+// handleRoomMoved updates local participant bookkeeping when the SDK
+// reports that our participant was moved to a different room, and marks
+// the Room as migrating so a concurrent OnDisconnected doesn't tear down
+// the SIP call. migrating stays set until both the LiveKit-side
+// reconnect (OnReconnected) and, if OnRoomMovedSIPAction requested one, a
+// SIP-side signalling action have completed, or watchMigrationTimeout
+// gives up and ends the call.
+func (r *Room) handleRoomMoved(conf *config.Config, rconf RoomConfig, newRoomName, newToken string) {
+	r.setReconnectReason(ReasonRoomMoved)
+
+	oldRoomName := rconf.RoomName
+
+	var action RoomMovedSIPAction
+	if rconf.OnRoomMovedSIPAction != nil {
+		action = rconf.OnRoomMovedSIPAction(oldRoomName, newRoomName)
+	}
+
+	steps := int32(1) // the LiveKit-side reconnect
+	if action.Kind != SIPActionNone {
+		steps++
+	}
+	r.migrationSteps.Store(steps)
+	r.migrating.Store(true)
+	gen := r.migrationGen.Inc()
+
+	if r.stats != nil {
+		r.stats.migrationStarted()
+	}
+
+	tokenAcquiredAt := time.Now()
+
+	r.mu.Lock()
+	r.p.RoomName = newRoomName
+	r.mu.Unlock()
+
+	r.log.Infow("room moved", "from", oldRoomName, "to", newRoomName)
+
+	r.publishCallEvent(rconf, CallEvent{
+		Type:            EventRoomMoved,
+		CallID:          rconf.CallID,
+		OldRoom:         oldRoomName,
+		NewRoom:         newRoomName,
+		TokenAcquiredAt: tokenAcquiredAt,
+		At:              tokenAcquiredAt,
+	})
+
+	if action.Kind != SIPActionNone {
+		r.performRoomMovedSIPAction(rconf, action, oldRoomName, newRoomName)
+	}
+
+	go r.watchMigrationTimeout(rconf, gen)
+}
+
+// watchMigrationTimeout is the failure path for a room-move: if migrating
+// is still set once rconf.migrationTimeout() elapses, the LiveKit-side
+// reconnect (and/or the SIP-side action) never completed, so there is no
+// other signal left that will ever clear migrating via
+// completeMigrationStep. Give up and tear the SIP call down instead of
+// leaving it wedged forever.
+//
+// gen is the migrationGen value handleRoomMoved stamped for the move this
+// watchdog was spawned for. A second move starting within the first
+// move's timeout window bumps migrationGen again, so if gen no longer
+// matches by the time the timer fires, this watchdog belongs to a move
+// that's already been superseded and must not tear down the call on
+// behalf of the move that superseded it.
+func (r *Room) watchMigrationTimeout(rconf RoomConfig, gen int32) {
+	select {
+	case <-time.After(rconf.migrationTimeout()):
+	case <-r.stopped.Watch():
+		return
+	}
+	if r.migrationGen.Load() != gen {
+		return
+	}
+	if r.migrating.CAS(true, false) {
+		r.log.Warnw("room move did not complete before the migration timeout, ending call", nil,
+			"callID", rconf.CallID, "timeout", rconf.migrationTimeout())
+		r.stopped.Break()
+	}
+}
+
+// publishCallEvent publishes ev on rconf.Transport, doing nothing if no
+// Transport/CallID is configured and only logging on failure: a dropped
+// lifecycle event must not affect the SIP call itself.
+func (r *Room) publishCallEvent(rconf RoomConfig, ev CallEvent) {
+	if rconf.Transport == nil || rconf.CallID == "" {
+		return
+	}
+	if err := rconf.Transport.PublishEvent(context.Background(), ev); err != nil {
+		r.log.Warnw("failed to publish call event", err, "callID", rconf.CallID, "type", string(ev.Type))
+	}
+}
+
+// NotifyRinging publishes an EventRinging lifecycle event on
+// rconf.Transport. The SIP dialog's ringing state lives outside this
+// package, so the caller is responsible for invoking this as soon as the
+// callee starts ringing.
+func (r *Room) NotifyRinging(rconf RoomConfig) {
+	r.publishCallEvent(rconf, CallEvent{Type: EventRinging, CallID: rconf.CallID, At: time.Now()})
+}
+
+// NotifyAnswered publishes an EventAnswered lifecycle event on
+// rconf.Transport. The SIP dialog's answer state lives outside this
+// package, so the caller is responsible for invoking this once the SIP
+// leg is answered.
+func (r *Room) NotifyAnswered(rconf RoomConfig) {
+	r.publishCallEvent(rconf, CallEvent{Type: EventAnswered, CallID: rconf.CallID, At: time.Now()})
+}
+
+// performRoomMovedSIPAction reports the SIP-side action chosen by
+// OnRoomMovedSIPAction as a lifecycle event on Transport, the same
+// control plane that carries room_moved itself, and completes the
+// migration step handleRoomMoved allocated for it regardless of outcome.
+func (r *Room) performRoomMovedSIPAction(rconf RoomConfig, action RoomMovedSIPAction, oldRoomName, newRoomName string) {
+	defer r.completeMigrationStep()
+
+	ev := CallEvent{
+		CallID:  rconf.CallID,
+		OldRoom: oldRoomName,
+		NewRoom: newRoomName,
+		At:      time.Now(),
+	}
+	switch action.Kind {
+	case SIPActionRefer:
+		ev.Type = EventSIPRefer
+		ev.TargetURI = action.TargetURI
+	case SIPActionReInvite:
+		ev.Type = EventSIPReInvite
+		ev.SDP = action.SDP
+	case SIPActionPlayAnnouncement:
+		ev.Type = EventSIPAnnounce
+		ev.AudioURI = action.AudioURI
+	}
+	r.publishCallEvent(rconf, ev)
+}
@@ -15,7 +15,9 @@
 package sip
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -62,6 +64,230 @@ func TestRoomMigration(t *testing.T) {
 	require.Equal(t, "Human Agent", room.p.Name, "participant name should not change")
 }
 
+// fakeEventPublisher records published events for assertions, in lieu of
+// a real JetStream connection.
+type fakeEventPublisher struct {
+	events []CallEvent
+}
+
+func (f *fakeEventPublisher) PublishEvent(_ context.Context, ev CallEvent) error {
+	f.events = append(f.events, ev)
+	return nil
+}
+
+// TestRoomMigrationPublishesRoomMovedEvent verifies that handleRoomMoved
+// publishes a room_moved event with the old/new room names and a token
+// acquisition timestamp when a Transport is configured.
+func TestRoomMigrationPublishesRoomMovedEvent(t *testing.T) {
+	log := logger.GetLogger()
+	room := NewRoom(log, &RoomStats{})
+	room.p = ParticipantInfo{RoomName: "original-room", Identity: "sip-participant"}
+
+	pub := &fakeEventPublisher{}
+	rconf := RoomConfig{
+		RoomName:  "original-room",
+		CallID:    "call-1",
+		Transport: pub,
+	}
+
+	before := time.Now()
+	room.handleRoomMoved(&config.Config{}, rconf, "destination-room", "new-jwt-token")
+	after := time.Now()
+
+	require.Len(t, pub.events, 1)
+	ev := pub.events[0]
+	require.Equal(t, EventRoomMoved, ev.Type)
+	require.Equal(t, "call-1", ev.CallID)
+	require.Equal(t, "original-room", ev.OldRoom)
+	require.Equal(t, "destination-room", ev.NewRoom)
+	require.False(t, ev.TokenAcquiredAt.Before(before))
+	require.False(t, ev.TokenAcquiredAt.After(after))
+}
+
+// TestNotifyRingingAndAnswered verify that the SIP-dialog-facing notify
+// methods publish the corresponding lifecycle events.
+func TestNotifyRingingAndAnswered(t *testing.T) {
+	log := logger.GetLogger()
+	room := NewRoom(log, &RoomStats{})
+
+	pub := &fakeEventPublisher{}
+	rconf := RoomConfig{CallID: "call-1", Transport: pub}
+
+	room.NotifyRinging(rconf)
+	room.NotifyAnswered(rconf)
+
+	require.Len(t, pub.events, 2)
+	require.Equal(t, EventRinging, pub.events[0].Type)
+	require.Equal(t, EventAnswered, pub.events[1].Type)
+	for _, ev := range pub.events {
+		require.Equal(t, "call-1", ev.CallID)
+	}
+}
+
+// TestRoomMigrationSIPActions verifies that each RoomMovedSIPAction kind
+// is reported as the matching lifecycle event, and that None publishes
+// nothing beyond room_moved itself.
+func TestRoomMigrationSIPActions(t *testing.T) {
+	cases := []struct {
+		name      string
+		action    RoomMovedSIPAction
+		wantEvent CallEventType // zero value means "no extra event"
+	}{
+		{name: "none", action: RoomMovedSIPAction{}, wantEvent: ""},
+		{name: "refer", action: Refer("sip:attendant@example.com"), wantEvent: EventSIPRefer},
+		{name: "reinvite", action: ReInviteWithSDP("v=0\r\n..."), wantEvent: EventSIPReInvite},
+		{name: "announce", action: PlayAnnouncement("https://example.com/hold.wav"), wantEvent: EventSIPAnnounce},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			log := logger.GetLogger()
+			room := NewRoom(log, &RoomStats{})
+			room.p = ParticipantInfo{RoomName: "original-room"}
+
+			pub := &fakeEventPublisher{}
+			rconf := RoomConfig{
+				RoomName:             "original-room",
+				CallID:               "call-1",
+				Transport:            pub,
+				OnRoomMovedSIPAction: func(string, string) RoomMovedSIPAction { return c.action },
+			}
+
+			room.handleRoomMoved(&config.Config{}, rconf, "destination-room", "tok")
+
+			if c.wantEvent == "" {
+				require.Len(t, pub.events, 1, "only room_moved should be published")
+				return
+			}
+
+			require.Len(t, pub.events, 2)
+			ev := pub.events[1]
+			require.Equal(t, c.wantEvent, ev.Type)
+			switch c.action.Kind {
+			case SIPActionRefer:
+				require.Equal(t, c.action.TargetURI, ev.TargetURI)
+			case SIPActionReInvite:
+				require.Equal(t, c.action.SDP, ev.SDP)
+			case SIPActionPlayAnnouncement:
+				require.Equal(t, c.action.AudioURI, ev.AudioURI)
+			}
+		})
+	}
+}
+
+// TestMigratingStaysSetUntilReconnectAndSIPActionComplete verifies that
+// the migrating fuse is only cleared once both the LiveKit-side
+// reconnect and the SIP-side action handleRoomMoved kicked off have
+// completed. The SIP-side action completes inside handleRoomMoved, so
+// only the order "SIP action, then reconnect" is exercised.
+func TestMigratingStaysSetUntilReconnectAndSIPActionComplete(t *testing.T) {
+	log := logger.GetLogger()
+	room := NewRoom(log, &RoomStats{})
+	room.p = ParticipantInfo{RoomName: "original-room"}
+
+	rconf := RoomConfig{
+		RoomName:             "original-room",
+		OnRoomMovedSIPAction: func(string, string) RoomMovedSIPAction { return Refer("sip:attendant@example.com") },
+	}
+
+	room.handleRoomMoved(&config.Config{}, rconf, "destination-room", "tok")
+	// performRoomMovedSIPAction already ran synchronously within
+	// handleRoomMoved, completing its own step; only the LiveKit
+	// reconnect step remains pending.
+	require.True(t, room.migrating.Load(), "migrating should stay set until the LiveKit reconnect completes too")
+
+	room.completeMigrationStep()
+	require.False(t, room.migrating.Load(), "migrating should clear once the reconnect step also completes")
+}
+
+// TestMigrationTimeoutEndsCallIfReconnectNeverCompletes verifies that a
+// room move which never gets an OnReconnected (the LiveKit-side reconnect
+// permanently fails) doesn't wedge the call forever: once
+// RoomConfig.MigrationTimeout elapses, migrating clears and stopped
+// breaks.
+func TestMigrationTimeoutEndsCallIfReconnectNeverCompletes(t *testing.T) {
+	log := logger.GetLogger()
+	room := NewRoom(log, &RoomStats{})
+	room.p = ParticipantInfo{RoomName: "original-room"}
+
+	rconf := RoomConfig{
+		RoomName:         "original-room",
+		MigrationTimeout: 10 * time.Millisecond,
+	}
+	room.handleRoomMoved(&config.Config{}, rconf, "destination-room", "tok")
+	require.True(t, room.migrating.Load())
+
+	require.Eventually(t, func() bool {
+		return !room.migrating.Load()
+	}, time.Second, time.Millisecond, "migrating should clear once the migration timeout elapses")
+
+	// The watchdog clears migrating before it breaks stopped, so wait for
+	// stopped rather than expecting it broken at the same instant.
+	select {
+	case <-room.stopped.Watch():
+	case <-time.After(time.Second):
+		t.Fatal("stopped should be broken once the migration timeout gives up on the reconnect")
+	}
+}
+
+// TestMigrationTimeoutDoesNotFireAfterSuccessfulReconnect verifies that a
+// room move which does complete (OnReconnected's completeMigrationStep
+// clears migrating) isn't later torn down by the stale watchdog once its
+// timeout eventually elapses.
+func TestMigrationTimeoutDoesNotFireAfterSuccessfulReconnect(t *testing.T) {
+	log := logger.GetLogger()
+	room := NewRoom(log, &RoomStats{})
+	room.p = ParticipantInfo{RoomName: "original-room"}
+
+	rconf := RoomConfig{
+		RoomName:         "original-room",
+		MigrationTimeout: 10 * time.Millisecond,
+	}
+	room.handleRoomMoved(&config.Config{}, rconf, "destination-room", "tok")
+	room.completeMigrationStep() // simulates OnReconnected firing in time
+
+	require.False(t, room.migrating.Load())
+
+	time.Sleep(50 * time.Millisecond) // let the watchdog's timer fire
+	select {
+	case <-room.stopped.Watch():
+		t.Fatal("stopped should not be broken; the reconnect succeeded before the timeout")
+	default:
+	}
+}
+
+// TestMigrationTimeoutDoesNotFireAfterSupersedingMove verifies that a
+// second room move starting within the first move's timeout window bumps
+// migrationGen, so the first move's watchdog no-ops instead of tearing
+// down the call that the second, still-in-progress move owns.
+func TestMigrationTimeoutDoesNotFireAfterSupersedingMove(t *testing.T) {
+	log := logger.GetLogger()
+	room := NewRoom(log, &RoomStats{})
+	room.p = ParticipantInfo{RoomName: "room-a"}
+
+	rconf := RoomConfig{
+		RoomName:         "room-a",
+		MigrationTimeout: 20 * time.Millisecond,
+	}
+	room.handleRoomMoved(&config.Config{}, rconf, "room-b", "tok-1")
+
+	// A second move supersedes the first before its watchdog fires.
+	rconf2 := RoomConfig{
+		RoomName:         "room-b",
+		MigrationTimeout: time.Hour,
+	}
+	room.handleRoomMoved(&config.Config{}, rconf2, "room-c", "tok-2")
+
+	time.Sleep(50 * time.Millisecond) // let the first move's watchdog timer fire
+
+	require.True(t, room.migrating.Load(), "the second move is still legitimately in progress")
+	select {
+	case <-room.stopped.Watch():
+		t.Fatal("the first move's stale watchdog must not tear down a call the second move owns")
+	default:
+	}
+}
+
 // TestRoomMigrationCallbacks verifies that the callbacks are properly registered.
 // This test ensures that OnRoomMoved, OnReconnecting, and OnReconnected handlers
 // are correctly set up during room connection.